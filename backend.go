@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Backend completes a chat turn against a configured model provider. It is
+// implemented by every backend type the mixer config can select, as well as
+// the legacy env-var-configured //ai default, so there's a single code path
+// for issuing a completion regardless of which trigger picked it.
+type Backend interface {
+	Complete(ctx context.Context, messages []Message, opts CompletionOptions) (CompletionResult, error)
+}
+
+// StreamingBackend is implemented by backends that can also stream a
+// completion as Server-Sent Events. Not every Backend needs to support this:
+// callers type-assert for it and fall back to a buffered Complete otherwise.
+type StreamingBackend interface {
+	Backend
+	Stream(ctx context.Context, messages []Message, opts CompletionOptions) (*http.Response, error)
+}
+
+// CompletionResult is a completed chat turn: either plain text, or the tool
+// calls the model made instead (e.g. propose_edits).
+type CompletionResult struct {
+	Content   string
+	ToolCalls []ToolCall
+}
+
+// CompletionOptions carries the per-backend generation parameters resolved
+// from the mixer config. Tools is only honored on a buffered Complete call;
+// Stream never sends it, since the SSE delta parser doesn't handle tool call
+// chunks.
+type CompletionOptions struct {
+	Model       string
+	Temperature float64
+	Tools       []interface{}
+}
+
+// BackendConfig describes one named entry in the mixer config file.
+type BackendConfig struct {
+	Name           string  `json:"name" yaml:"name"`
+	Type           string  `json:"type" yaml:"type"` // "openai", "azure", or "local"
+	Trigger        string  `json:"trigger" yaml:"trigger"`
+	Model          string  `json:"model" yaml:"model"`
+	URL            string  `json:"url" yaml:"url"`
+	Token          string  `json:"token" yaml:"token"`
+	APIVersion     string  `json:"api_version" yaml:"api_version"` // Azure only
+	PromptTemplate string  `json:"prompt_template" yaml:"prompt_template"`
+	Temperature    float64 `json:"temperature" yaml:"temperature"`
+}
+
+// MixerConfig is the top-level shape of the backends config file.
+type MixerConfig struct {
+	Backends []BackendConfig `json:"backends" yaml:"backends"`
+}
+
+// registeredBackend pairs a constructed Backend with the config it was built
+// from, so callers still have access to the model/temperature/prompt to use.
+type registeredBackend struct {
+	cfg     BackendConfig
+	backend Backend
+}
+
+// backendRegistry maps a trigger suffix (e.g. "//gpt4") to the backend it
+// selects. Populated once at startup from the mixer config file.
+var backendRegistry = map[string]registeredBackend{}
+
+// loadBackendRegistry reads the mixer config at path, builds a Backend for
+// each entry, and registers it under its trigger suffix.
+func loadBackendRegistry(path string, client *http.Client) {
+	cfg, err := loadMixerConfig(path)
+	if err != nil {
+		log.Error().Err(err).Str("path", path).Msg("Error loading mixer config")
+		return
+	}
+
+	for _, b := range cfg.Backends {
+		backend, err := buildBackend(b, client)
+		if err != nil {
+			log.Error().Err(err).Str("backend", b.Name).Msg("Error configuring backend")
+			continue
+		}
+
+		trigger := b.Trigger
+		if trigger == "" {
+			trigger = "//" + b.Name
+		}
+		backendRegistry[trigger] = registeredBackend{cfg: b, backend: backend}
+		log.Debug().Str("trigger", trigger).Str("backend", b.Name).Msg("Registered backend")
+	}
+}
+
+// loadMixerConfig reads a YAML or JSON backends config, chosen by file
+// extension.
+func loadMixerConfig(path string) (*MixerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg MixerConfig
+	if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+		err = yaml.Unmarshal(data, &cfg)
+	} else {
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// buildBackend constructs the concrete Backend implementation for a config
+// entry.
+func buildBackend(cfg BackendConfig, client *http.Client) (Backend, error) {
+	switch cfg.Type {
+	case "", "openai", "local":
+		// Local llama.cpp/LocalAI servers speak the same OpenAI-compatible
+		// /chat/completions API, so they share the same implementation.
+		return &openAIBackend{cfg: cfg, client: client}, nil
+	case "azure":
+		return &azureBackend{cfg: cfg, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend type %q for backend %q", cfg.Type, cfg.Name)
+	}
+}
+
+// openAIBackend talks to any OpenAI-compatible /chat/completions endpoint.
+// The legacy env-var-configured //ai default is also built as one of these,
+// so it shares this same request/response handling instead of a parallel
+// hand-rolled implementation.
+type openAIBackend struct {
+	cfg    BackendConfig
+	client *http.Client
+}
+
+// legacyBackend builds the openAIBackend for the default //ai trigger from
+// the OPENAI_* env vars, used when no configured backend's trigger matches.
+func legacyBackend(client *http.Client) *openAIBackend {
+	return &openAIBackend{
+		cfg: BackendConfig{
+			Name:  "default",
+			Type:  "openai",
+			Model: os.Getenv("OPENAI_MODEL"),
+			URL:   os.Getenv("OPENAI_URL"),
+			Token: os.Getenv("OPENAI_TOKEN"),
+		},
+		client: client,
+	}
+}
+
+func (b *openAIBackend) buildRequest(ctx context.Context, messages []Message, opts CompletionOptions, stream bool) (*http.Request, error) {
+	body := map[string]interface{}{
+		"model":       opts.Model,
+		"temperature": opts.Temperature,
+		"messages":    messages,
+	}
+	if stream {
+		body["stream"] = true
+	} else if len(opts.Tools) > 0 {
+		body["tools"] = opts.Tools
+	}
+	reqBody, _ := json.Marshal(body)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", b.cfg.URL+"/chat/completions", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+b.cfg.Token)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	return req, nil
+}
+
+func (b *openAIBackend) Complete(ctx context.Context, messages []Message, opts CompletionOptions) (CompletionResult, error) {
+	req, err := b.buildRequest(ctx, messages, opts, false)
+	if err != nil {
+		return CompletionResult{}, err
+	}
+	return doCompletionRequest(b.client, req)
+}
+
+func (b *openAIBackend) Stream(ctx context.Context, messages []Message, opts CompletionOptions) (*http.Response, error) {
+	req, err := b.buildRequest(ctx, messages, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return doRequestWithRetry(b.client, req)
+}
+
+// azureBackend talks to Azure OpenAI, which needs the api-version query
+// parameter and an api-key header instead of a bearer token.
+type azureBackend struct {
+	cfg    BackendConfig
+	client *http.Client
+}
+
+func (b *azureBackend) buildRequest(ctx context.Context, messages []Message, opts CompletionOptions, stream bool) (*http.Request, error) {
+	body := map[string]interface{}{
+		"model":       opts.Model,
+		"temperature": opts.Temperature,
+		"messages":    messages,
+	}
+	if stream {
+		body["stream"] = true
+	} else if len(opts.Tools) > 0 {
+		body["tools"] = opts.Tools
+	}
+	reqBody, _ := json.Marshal(body)
+
+	endpoint := b.cfg.URL + "/chat/completions?api-version=" + url.QueryEscape(b.cfg.APIVersion)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api-key", b.cfg.Token)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	return req, nil
+}
+
+func (b *azureBackend) Complete(ctx context.Context, messages []Message, opts CompletionOptions) (CompletionResult, error) {
+	req, err := b.buildRequest(ctx, messages, opts, false)
+	if err != nil {
+		return CompletionResult{}, err
+	}
+	return doCompletionRequest(b.client, req)
+}
+
+func (b *azureBackend) Stream(ctx context.Context, messages []Message, opts CompletionOptions) (*http.Response, error) {
+	req, err := b.buildRequest(ctx, messages, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	return doRequestWithRetry(b.client, req)
+}
+
+// doCompletionRequest executes a chat completion request, retrying 429/5xx
+// responses with backoff, and extracts the first choice's message content
+// and any tool calls it made.
+func doCompletionRequest(client *http.Client, req *http.Request) (CompletionResult, error) {
+	resp, err := doRequestWithRetry(client, req)
+	if err != nil {
+		return CompletionResult{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return CompletionResult{}, errors.New(decodeProviderError(resp))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content   string     `json:"content"`
+				ToolCalls []ToolCall `json:"tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return CompletionResult{}, err
+	}
+	if len(result.Choices) == 0 {
+		return CompletionResult{}, nil
+	}
+	message := result.Choices[0].Message
+	return CompletionResult{Content: message.Content, ToolCalls: message.ToolCalls}, nil
+}
+
+// buildBackendMessages applies a backend's configured prompt template as a
+// system message ahead of the cleaned user text, matching the OPENAI_PROMPT
+// convention used by the legacy default backend.
+func buildBackendMessages(cfg BackendConfig, cleanText string) []Message {
+	var messages []Message
+	if cfg.PromptTemplate != "" {
+		messages = append(messages, Message{Role: "system", Content: cfg.PromptTemplate})
+	}
+	messages = append(messages, Message{Role: "user", Content: cleanText})
+	return messages
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// TestOpenAIBackendBuildRequestToolsVsStream guards the chunk0-4 regression:
+// tool-calling must only depend on whether this particular request is a
+// buffered Complete or an SSE Stream, never on the global streamEnabled
+// flag, so enabling --stream doesn't silently drop propose_edits for
+// clients that never ask for text/event-stream.
+func TestOpenAIBackendBuildRequestToolsVsStream(t *testing.T) {
+	b := &openAIBackend{cfg: BackendConfig{URL: "http://upstream.example", Token: "tok"}}
+	messages := []Message{{Role: "user", Content: "hello"}}
+	opts := CompletionOptions{Model: "gpt-test", Tools: []interface{}{proposeEditsTool}}
+
+	req, err := b.buildRequest(context.Background(), messages, opts, false)
+	if err != nil {
+		t.Fatalf("buildRequest(stream=false) error: %v", err)
+	}
+	body := decodeRequestBody(t, req)
+	if _, ok := body["tools"]; !ok {
+		t.Error("buffered Complete request is missing tools even though opts.Tools was set")
+	}
+	if _, ok := body["stream"]; ok {
+		t.Error("buffered Complete request should not set stream")
+	}
+
+	req, err = b.buildRequest(context.Background(), messages, opts, true)
+	if err != nil {
+		t.Fatalf("buildRequest(stream=true) error: %v", err)
+	}
+	body = decodeRequestBody(t, req)
+	if stream, _ := body["stream"].(bool); !stream {
+		t.Error("Stream request did not set stream=true")
+	}
+	if _, ok := body["tools"]; ok {
+		t.Error("Stream request should never send tools; the SSE delta parser can't handle tool call chunks")
+	}
+	if accept := req.Header.Get("Accept"); accept != "text/event-stream" {
+		t.Errorf("Stream request Accept header = %q, want text/event-stream", accept)
+	}
+}
+
+func decodeRequestBody(t *testing.T, req *http.Request) map[string]interface{} {
+	t.Helper()
+	raw, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("reading request body: %v", err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatalf("decoding request body: %v", err)
+	}
+	return body
+}
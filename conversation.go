@@ -0,0 +1,351 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// sessionCookieName stores the per-editor session token minted for clients
+// that don't send their own X-LT-Session header.
+const sessionCookieName = "lt_ai_session"
+
+// sessionKey derives the conversation key for a request from the client IP
+// plus a per-editor session token, so successive //ai calls from the same
+// editor build one thread. It mints and sets a cookie if neither a cookie
+// nor the X-LT-Session header carries a token yet.
+func sessionKey(w http.ResponseWriter, r *http.Request) string {
+	token := r.Header.Get("X-LT-Session")
+	if token == "" {
+		if cookie, err := r.Cookie(sessionCookieName); err == nil {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		token = generateSessionToken()
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookieName,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int((24 * time.Hour).Seconds()),
+			HttpOnly: true,
+		})
+	}
+	return clientIP(r) + ":" + token
+}
+
+// clientIP strips the port from r.RemoteAddr, falling back to the raw value
+// if it isn't in host:port form.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func generateSessionToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		log.Error().Err(err).Msg("Error generating session token")
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Message is a single turn in a conversation, shaped to drop straight into
+// an OpenAI-compatible `messages` array.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ConversationStore persists per-session message history so multi-turn //ai
+// conversations survive across requests.
+type ConversationStore interface {
+	Get(id string) []Message
+	Append(id string, messages ...Message)
+	Reset(id string)
+	Undo(id string)
+}
+
+const defaultConversationCacheSize = 1000
+
+// conversationStore is the process-wide conversation history backend,
+// selected at startup by newConversationStore.
+var conversationStore ConversationStore = newLRUConversationStore(defaultConversationCacheSize)
+
+// newConversationStore builds the configured ConversationStore. It reads
+// CONVERSATION_STORE ("memory", the default, "redis", or "bolt") plus the
+// matching backend settings, and always wraps the persistent backends in the
+// in-memory LRU so hot sessions don't round-trip on every turn.
+func newConversationStore() ConversationStore {
+	size := defaultConversationCacheSize
+	if raw := os.Getenv("CONVERSATION_CACHE_SIZE"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			size = n
+		}
+	}
+	lru := newLRUConversationStore(size)
+
+	switch os.Getenv("CONVERSATION_STORE") {
+	case "redis":
+		store, err := newRedisConversationStore(os.Getenv("REDIS_ADDR"), lru)
+		if err != nil {
+			log.Error().Err(err).Msg("Error connecting to Redis, falling back to in-memory conversation store")
+			return lru
+		}
+		return store
+	case "bolt":
+		store, err := newBoltConversationStore(os.Getenv("BOLT_PATH"), lru)
+		if err != nil {
+			log.Error().Err(err).Msg("Error opening BoltDB, falling back to in-memory conversation store")
+			return lru
+		}
+		return store
+	default:
+		return lru
+	}
+}
+
+// lruConversationStore is the default, in-memory conversation backend.
+type lruConversationStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type lruEntry struct {
+	id       string
+	messages []Message
+}
+
+func newLRUConversationStore(capacity int) *lruConversationStore {
+	return &lruConversationStore{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (s *lruConversationStore) Get(id string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[id]
+	if !ok {
+		return nil
+	}
+	s.order.MoveToFront(el)
+	return append([]Message(nil), el.Value.(*lruEntry).messages...)
+}
+
+func (s *lruConversationStore) Append(id string, messages ...Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[id]
+	if !ok {
+		el = s.order.PushFront(&lruEntry{id: id})
+		s.entries[id] = el
+		s.evictLocked()
+	} else {
+		s.order.MoveToFront(el)
+	}
+	entry := el.Value.(*lruEntry)
+	entry.messages = append(entry.messages, messages...)
+}
+
+func (s *lruConversationStore) Reset(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[id]; ok {
+		s.order.Remove(el)
+		delete(s.entries, id)
+	}
+}
+
+func (s *lruConversationStore) Undo(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[id]
+	if !ok {
+		return
+	}
+	entry := el.Value.(*lruEntry)
+	// A turn is a user message followed by the assistant's reply.
+	if n := len(entry.messages); n >= 2 {
+		entry.messages = entry.messages[:n-2]
+	} else {
+		entry.messages = nil
+	}
+}
+
+// evictLocked drops the least-recently-used conversation once capacity is
+// exceeded. Callers must hold s.mu.
+func (s *lruConversationStore) evictLocked() {
+	if s.capacity <= 0 || s.order.Len() <= s.capacity {
+		return
+	}
+	oldest := s.order.Back()
+	if oldest == nil {
+		return
+	}
+	s.order.Remove(oldest)
+	delete(s.entries, oldest.Value.(*lruEntry).id)
+}
+
+// redisConversationStore persists history in Redis so it survives restarts
+// and is shared across replicas, with lru as a fast in-process cache.
+type redisConversationStore struct {
+	client *redis.Client
+	lru    *lruConversationStore
+}
+
+func newRedisConversationStore(addr string, lru *lruConversationStore) (*redisConversationStore, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, err
+	}
+	return &redisConversationStore{client: client, lru: lru}, nil
+}
+
+func (s *redisConversationStore) Get(id string) []Message {
+	if cached := s.lru.Get(id); cached != nil {
+		return cached
+	}
+
+	raw, err := s.client.Get(context.Background(), id).Bytes()
+	if err != nil {
+		return nil
+	}
+	var messages []Message
+	if err := json.Unmarshal(raw, &messages); err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Error decoding conversation from Redis")
+		return nil
+	}
+	s.lru.Append(id, messages...)
+	return messages
+}
+
+func (s *redisConversationStore) Append(id string, messages ...Message) {
+	s.lru.Append(id, messages...)
+	s.save(id)
+}
+
+func (s *redisConversationStore) Reset(id string) {
+	s.lru.Reset(id)
+	s.client.Del(context.Background(), id)
+}
+
+func (s *redisConversationStore) Undo(id string) {
+	s.Get(id) // hydrate the LRU from Redis first, or Undo is a no-op and save below wipes the stored history
+	s.lru.Undo(id)
+	s.save(id)
+}
+
+func (s *redisConversationStore) save(id string) {
+	raw, err := json.Marshal(s.lru.Get(id))
+	if err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Error encoding conversation for Redis")
+		return
+	}
+	if err := s.client.Set(context.Background(), id, raw, 24*time.Hour).Err(); err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Error saving conversation to Redis")
+	}
+}
+
+// boltConversationStore persists history in a local BoltDB file, with lru as
+// a fast in-process cache.
+type boltConversationStore struct {
+	db     *bolt.DB
+	bucket []byte
+	lru    *lruConversationStore
+}
+
+func newBoltConversationStore(path string, lru *lruConversationStore) (*boltConversationStore, error) {
+	if path == "" {
+		path = "conversations.db"
+	}
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	bucket := []byte("conversations")
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return &boltConversationStore{db: db, bucket: bucket, lru: lru}, nil
+}
+
+func (s *boltConversationStore) Get(id string) []Message {
+	if cached := s.lru.Get(id); cached != nil {
+		return cached
+	}
+
+	var messages []Message
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(s.bucket).Get([]byte(id))
+		if raw == nil {
+			return nil
+		}
+		return json.Unmarshal(raw, &messages)
+	})
+	if err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Error reading conversation from BoltDB")
+		return nil
+	}
+	if messages != nil {
+		s.lru.Append(id, messages...)
+	}
+	return messages
+}
+
+func (s *boltConversationStore) Append(id string, messages ...Message) {
+	s.lru.Append(id, messages...)
+	s.save(id)
+}
+
+func (s *boltConversationStore) Reset(id string) {
+	s.lru.Reset(id)
+	_ = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Delete([]byte(id))
+	})
+}
+
+func (s *boltConversationStore) Undo(id string) {
+	s.Get(id) // hydrate the LRU from BoltDB first, or Undo is a no-op and save below wipes the stored history
+	s.lru.Undo(id)
+	s.save(id)
+}
+
+func (s *boltConversationStore) save(id string) {
+	raw, err := json.Marshal(s.lru.Get(id))
+	if err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Error encoding conversation for BoltDB")
+		return
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Put([]byte(id), raw)
+	})
+	if err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Error saving conversation to BoltDB")
+	}
+}
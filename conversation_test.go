@@ -0,0 +1,140 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLRUConversationStoreAppendAndGet(t *testing.T) {
+	s := newLRUConversationStore(10)
+	s.Append("a", Message{Role: "user", Content: "hi"})
+	s.Append("a", Message{Role: "assistant", Content: "hello"})
+
+	got := s.Get("a")
+	if len(got) != 2 || got[0].Content != "hi" || got[1].Content != "hello" {
+		t.Fatalf("Get(a) = %+v, want two messages hi/hello", got)
+	}
+}
+
+func TestLRUConversationStoreGetMissing(t *testing.T) {
+	s := newLRUConversationStore(10)
+	if got := s.Get("missing"); got != nil {
+		t.Fatalf("Get(missing) = %+v, want nil", got)
+	}
+}
+
+func TestLRUConversationStoreEvictsOldest(t *testing.T) {
+	s := newLRUConversationStore(2)
+	s.Append("a", Message{Role: "user", Content: "1"})
+	s.Append("b", Message{Role: "user", Content: "2"})
+	s.Append("c", Message{Role: "user", Content: "3"}) // should evict "a", the least recently used
+
+	if got := s.Get("a"); got != nil {
+		t.Errorf("Get(a) = %+v, want nil after eviction", got)
+	}
+	if got := s.Get("b"); got == nil {
+		t.Error("Get(b) = nil, want it to still be present")
+	}
+	if got := s.Get("c"); got == nil {
+		t.Error("Get(c) = nil, want it to still be present")
+	}
+}
+
+func TestLRUConversationStoreGetRefreshesRecency(t *testing.T) {
+	s := newLRUConversationStore(2)
+	s.Append("a", Message{Role: "user", Content: "1"})
+	s.Append("b", Message{Role: "user", Content: "2"})
+	s.Get("a")                                         // touch "a" so "b" becomes least recently used
+	s.Append("c", Message{Role: "user", Content: "3"}) // should evict "b", not "a"
+
+	if got := s.Get("a"); got == nil {
+		t.Error("Get(a) = nil, want it to survive eviction after being refreshed")
+	}
+	if got := s.Get("b"); got != nil {
+		t.Errorf("Get(b) = %+v, want nil after eviction", got)
+	}
+}
+
+func TestLRUConversationStoreZeroCapacityNeverEvicts(t *testing.T) {
+	s := newLRUConversationStore(0)
+	s.Append("a", Message{Role: "user", Content: "1"})
+	s.Append("b", Message{Role: "user", Content: "2"})
+
+	if got := s.Get("a"); got == nil {
+		t.Error("Get(a) = nil, want a zero-capacity store to never evict")
+	}
+}
+
+func TestLRUConversationStoreReset(t *testing.T) {
+	s := newLRUConversationStore(10)
+	s.Append("a", Message{Role: "user", Content: "1"})
+	s.Reset("a")
+
+	if got := s.Get("a"); got != nil {
+		t.Fatalf("Get(a) = %+v, want nil after Reset", got)
+	}
+}
+
+func TestLRUConversationStoreUndoPopsLastTurn(t *testing.T) {
+	s := newLRUConversationStore(10)
+	s.Append("a",
+		Message{Role: "user", Content: "first"},
+		Message{Role: "assistant", Content: "reply one"},
+		Message{Role: "user", Content: "second"},
+		Message{Role: "assistant", Content: "reply two"},
+	)
+
+	s.Undo("a")
+
+	got := s.Get("a")
+	if len(got) != 2 || got[1].Content != "reply one" {
+		t.Fatalf("Get(a) after Undo = %+v, want the first turn only", got)
+	}
+}
+
+func TestLRUConversationStoreUndoOddLengthHistory(t *testing.T) {
+	s := newLRUConversationStore(10)
+	s.Append("a", Message{Role: "user", Content: "only one message"})
+
+	s.Undo("a")
+
+	if got := s.Get("a"); len(got) != 0 {
+		t.Fatalf("Get(a) after Undo on odd-length history = %+v, want empty", got)
+	}
+}
+
+func TestLRUConversationStoreUndoEmptyHistory(t *testing.T) {
+	s := newLRUConversationStore(10)
+	s.Undo("never-appended") // must not panic on a key that was never created
+}
+
+// TestBoltConversationStoreUndoHydratesColdCache guards against Undo
+// wiping a persisted conversation when it's not currently warm in the LRU
+// (e.g. evicted under load, or right after a process restart): Undo must
+// hydrate from BoltDB before popping the last turn, not silently no-op and
+// then save an empty history back over the real one.
+func TestBoltConversationStoreUndoHydratesColdCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.db")
+	lru := newLRUConversationStore(10)
+	store, err := newBoltConversationStore(path, lru)
+	if err != nil {
+		t.Fatalf("newBoltConversationStore() error: %v", err)
+	}
+	defer store.db.Close()
+
+	store.Append("a",
+		Message{Role: "user", Content: "first"},
+		Message{Role: "assistant", Content: "reply one"},
+		Message{Role: "user", Content: "second"},
+		Message{Role: "assistant", Content: "reply two"},
+	)
+
+	lru.Reset("a") // simulate the conversation falling out of the in-process cache
+
+	store.Undo("a")
+
+	got := store.Get("a")
+	if len(got) != 2 || got[1].Content != "reply one" {
+		t.Fatalf("Get(a) after cold-cache Undo = %+v, want the first turn preserved", got)
+	}
+}
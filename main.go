@@ -1,12 +1,15 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,6 +17,23 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// streamEnabled opts the proxy into requesting SSE chat completions from the
+// upstream model instead of a single blocking response.
+var streamEnabled bool
+
+// handleTemplatesEndpoint serves GET /v2/ai/templates, listing the loaded
+// prompt templates so editor plugins can build a selection menu.
+func handleTemplatesEndpoint(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Path != "/v2/ai/templates" || r.Method != "GET" {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"templates": templateNames()})
+	return true
+}
+
 func handleSpecialRequest(w http.ResponseWriter, r *http.Request, client *http.Client) bool {
 	if r.URL.Path != "/v2/check" || r.Method != "POST" {
 		return false
@@ -27,13 +47,14 @@ func handleSpecialRequest(w http.ResponseWriter, r *http.Request, client *http.C
 	}
 
 	// Check text and data parameters
-	cleanText, foundSpecial := checkSpecialParams(r)
+	cleanText, trigger, foundSpecial := checkSpecialParams(r)
 
 	log.Debug().
 		Str("text_param", r.FormValue("text")).
 		Str("data_param", r.FormValue("data")).
 		Interface("all_params", r.Form).
 		Bool("foundSpecial", foundSpecial).
+		Str("trigger", trigger).
 		Msg("Form parameters")
 
 	if cleanText == "" {
@@ -45,33 +66,148 @@ func handleSpecialRequest(w http.ResponseWriter, r *http.Request, client *http.C
 		return false
 	}
 
-	responseText := callOpenAI(client, cleanText)
+	if rateLimiter != nil {
+		if allowed, retryAfter := rateLimiter.Allow(clientIP(r)); !allowed {
+			sendErrorAIResponse(w, cleanText, fmt.Sprintf("Rate limited, try again in %ds", int(retryAfter.Round(time.Second).Seconds())), "")
+			return true
+		}
+	}
+
+	if entry, ok := backendRegistry[trigger]; ok {
+		messages := buildBackendMessages(entry.cfg, cleanText)
+		opts := CompletionOptions{
+			Model:       entry.cfg.Model,
+			Temperature: entry.cfg.Temperature,
+			Tools:       []interface{}{proposeEditsTool},
+		}
+
+		if streamEnabled && wantsEventStream(r) {
+			if sb, ok := entry.backend.(StreamingBackend); ok {
+				streamAIResponse(w, sb, messages, opts, "", cleanText)
+				return true
+			}
+		}
+
+		responseText, edits, err := callOpenAI(r.Context(), entry.backend, messages, opts)
+		if err != nil {
+			log.Error().Err(err).Str("backend", entry.cfg.Name).Msg("Error completing backend request")
+			sendErrorAIResponse(w, cleanText, err.Error(), "")
+			return true
+		}
+		if len(edits) > 0 {
+			sendStructuredAIResponse(w, edits, "")
+			return true
+		}
+		if responseText == "" {
+			return true
+		}
+		sendAIResponse(w, cleanText, responseText, "")
+		return true
+	}
+
+	// Fall back to the single env-var-configured model for the default //ai
+	// trigger, which carries conversation history keyed by editor session.
+	convID := sessionKey(w, r)
+
+	switch trigger {
+	case undoTrigger:
+		conversationStore.Undo(convID)
+		sendAIResponse(w, cleanText, "Last turn undone.", convID)
+		return true
+	case newThreadTrigger:
+		conversationStore.Reset(convID)
+	}
+
+	promptText := cleanText
+	if strings.HasPrefix(trigger, templateTriggerPrefix) {
+		name, argsRaw := parseTemplateTrigger(trigger)
+		tmpl, ok := templateLibrary[name]
+		if !ok {
+			sendErrorAIResponse(w, cleanText, fmt.Sprintf("Unknown prompt template %q", name), convID)
+			return true
+		}
+		rendered, err := renderPromptTemplate(tmpl, cleanText, argsRaw)
+		if err != nil {
+			log.Error().Err(err).Str("template", name).Msg("Error rendering prompt template")
+			sendErrorAIResponse(w, cleanText, err.Error(), convID)
+			return true
+		}
+		promptText = rendered
+	}
+
+	messages := buildMessages(convID, promptText)
+	backend := legacyBackend(client)
+	opts := CompletionOptions{
+		Model: backend.cfg.Model,
+		Tools: []interface{}{proposeEditsTool},
+	}
+
+	if streamEnabled && wantsEventStream(r) {
+		streamAIResponse(w, backend, messages, opts, convID, cleanText)
+		return true
+	}
+
+	responseText, edits, err := callOpenAI(r.Context(), backend, messages, opts)
+	if err != nil {
+		log.Error().Err(err).Msg("Error completing OpenAI request")
+		sendErrorAIResponse(w, cleanText, err.Error(), convID)
+		return true
+	}
+	if len(edits) > 0 {
+		conversationStore.Append(convID, Message{Role: "user", Content: cleanText}, Message{Role: "assistant", Content: summarizeProposedEdits(edits)})
+		sendStructuredAIResponse(w, edits, convID)
+		return true
+	}
 	if responseText == "" {
 		return true
 	}
 
-	sendAIResponse(w, cleanText, responseText)
+	conversationStore.Append(convID, Message{Role: "user", Content: cleanText}, Message{Role: "assistant", Content: responseText})
+	sendAIResponse(w, cleanText, responseText, convID)
 	return true
 }
 
-func checkSpecialParams(r *http.Request) (string, bool) {
+// buildMessages resolves the full message history for a conversation: the
+// optional system prompt, prior turns, then the new user message.
+func buildMessages(convID, cleanText string) []Message {
+	var messages []Message
+	if systemPrompt := os.Getenv("OPENAI_PROMPT"); systemPrompt != "" {
+		messages = append(messages, Message{Role: "system", Content: systemPrompt})
+	}
+	messages = append(messages, conversationStore.Get(convID)...)
+	messages = append(messages, Message{Role: "user", Content: cleanText})
+	return messages
+}
+
+// wantsEventStream reports whether the client asked for progressive
+// Server-Sent Events instead of a single buffered LanguageTool response.
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// defaultTrigger is the built-in suffix handled by the legacy, single-model
+// env-var configuration when no matching backend is registered.
+// newThreadTrigger resets the session's conversation before it's treated as
+// a default //ai turn; undoTrigger pops the last turn with no new prompt.
+const (
+	defaultTrigger   = "//ai"
+	newThreadTrigger = "//ai-new"
+	undoTrigger      = "//ai-undo"
+)
+
+func checkSpecialParams(r *http.Request) (string, string, bool) {
 	// Check required parameters
 	text := r.FormValue("text")
 	data := r.FormValue("data")
 
 	if text == "" && data == "" {
 		log.Warn().Msg("Missing required text or data parameters")
-		return "", true // Return true for error handling
+		return "", "", true // Return true for error handling
 	}
 
-	// For regular requests (without //ai) just return the text
+	// For regular requests (without a recognized trigger) just return the text
 	if text != "" {
-		if !strings.HasSuffix(strings.TrimSpace(text), "//ai") {
-			return text, false
-		}
-		// Handle special request with //ai
-		cleanText := text[:strings.LastIndex(text, "//ai")]
-		return cleanText, true
+		return matchTrigger(text)
 	}
 
 	// Handle data parameter
@@ -80,67 +216,202 @@ func checkSpecialParams(r *http.Request) (string, bool) {
 			Text string `json:"text"`
 		}
 		if err := json.Unmarshal([]byte(data), &jsonData); err == nil && jsonData.Text != "" {
-			if !strings.HasSuffix(strings.TrimSpace(jsonData.Text), "//ai") {
-				return jsonData.Text, false
-			}
-			// Handle special request with //ai
-			cleanText := jsonData.Text[:strings.LastIndex(jsonData.Text, "//ai")]
-			return cleanText, true
+			return matchTrigger(jsonData.Text)
 		}
 	}
 
-	return "", false
+	return "", "", false
 }
 
-func callOpenAI(client *http.Client, prompt string) string {
-	fullPrompt := prompt
-	if systemPrompt := os.Getenv("OPENAI_PROMPT"); systemPrompt != "" {
-		fullPrompt = systemPrompt + "\n\n" + prompt
+// matchTrigger strips a recognized trigger suffix (e.g. //ai, //gpt4, //code)
+// from text and reports which backend it selects. Candidates are tried
+// longest-first so that, e.g., a configured "/ai" trigger can't shadow the
+// built-in "//ai" when both are suffixes of the submitted text; iterating
+// backendRegistry directly would make that nondeterministic, since Go
+// randomizes map iteration order.
+func matchTrigger(text string) (string, string, bool) {
+	trimmed := strings.TrimSpace(text)
+
+	candidates := make([]string, 0, len(backendRegistry)+3)
+	for trigger := range backendRegistry {
+		candidates = append(candidates, trigger)
 	}
+	candidates = append(candidates, newThreadTrigger, undoTrigger, defaultTrigger)
+	sort.Slice(candidates, func(i, j int) bool { return len(candidates[i]) > len(candidates[j]) })
 
-	openaiReqBody, _ := json.Marshal(map[string]interface{}{
-		"model": os.Getenv("OPENAI_MODEL"),
-		"messages": []map[string]string{
-			{"role": "user", "content": fullPrompt},
-		},
-	})
+	for _, trigger := range candidates {
+		if strings.HasSuffix(trimmed, trigger) {
+			return text[:strings.LastIndex(text, trigger)], trigger, true
+		}
+	}
 
-	openaiReq, err := http.NewRequest("POST", os.Getenv("OPENAI_URL")+"/chat/completions", bytes.NewBuffer(openaiReqBody))
-	if err != nil {
-		log.Error().Err(err).Msg("Error creating OpenAI request")
-		return ""
+	if trigger := templateTriggerRe.FindString(trimmed); trigger != "" {
+		return text[:strings.LastIndex(text, trigger)], trigger, true
 	}
 
-	openaiReq.Header.Set("Content-Type", "application/json")
-	openaiReq.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_TOKEN"))
+	return text, "", false
+}
 
-	openaiResp, err := client.Do(openaiReq)
+// callOpenAI completes messages against backend and returns either a
+// plain-text reply or, when the model calls the propose_edits tool, the
+// structured edits it proposed instead. It's shared by the default //ai
+// trigger and every configured backend, so tool-calling and error handling
+// behave identically regardless of which trigger selected the backend.
+func callOpenAI(ctx context.Context, backend Backend, messages []Message, opts CompletionOptions) (string, []ProposedEdit, error) {
+	result, err := backend.Complete(ctx, messages, opts)
 	if err != nil {
-		log.Error().Err(err).Msg("Error making OpenAI request")
-		return ""
+		return "", nil, err
 	}
-	defer openaiResp.Body.Close()
+	if edits, ok := parseProposedEdits(result.ToolCalls); ok {
+		return "", edits, nil
+	}
+	return result.Content, nil, nil
+}
 
-	var openaiResult struct {
+// nextOpenAIChunk extracts the delta content from a single SSE `data: ...`
+// line. It returns done=true once the `[DONE]` sentinel is seen.
+func nextOpenAIChunk(line string) (delta string, done bool) {
+	payload := strings.TrimPrefix(strings.TrimSpace(line), "data: ")
+	if payload == "" {
+		return "", false
+	}
+	if payload == "[DONE]" {
+		return "", true
+	}
+
+	var chunk struct {
 		Choices []struct {
-			Message struct {
+			Delta struct {
 				Content string `json:"content"`
-			} `json:"message"`
+			} `json:"delta"`
 		} `json:"choices"`
 	}
-	if err := json.NewDecoder(openaiResp.Body).Decode(&openaiResult); err != nil {
-		log.Error().Err(err).Msg("Error decoding OpenAI response")
-		return ""
+	if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+		log.Debug().Err(err).Str("payload", payload).Msg("Skipping malformed SSE chunk")
+		return "", false
+	}
+	if len(chunk.Choices) == 0 {
+		return "", false
 	}
+	return chunk.Choices[0].Delta.Content, false
+}
 
-	if len(openaiResult.Choices) > 0 {
-		return openaiResult.Choices[0].Message.Content
+// readSSEContent buffers an entire SSE completion body and accumulates it
+// into the same plain text Complete returns as Content for non-streaming
+// requests.
+func readSSEContent(body io.Reader) (string, error) {
+	var content strings.Builder
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		delta, done := nextOpenAIChunk(line)
+		if done {
+			break
+		}
+		content.WriteString(delta)
 	}
-	return ""
+	return content.String(), scanner.Err()
 }
 
-func sendAIResponse(w http.ResponseWriter, cleanText, responseText string) {
-	response := map[string]interface{}{
+// streamAIResponse proxies an SSE chat completion straight through to the
+// editor as it arrives, flushing each accumulated partial match instead of
+// waiting for the full 60-second round-trip. opts.Tools is ignored here:
+// Stream never requests tool calls, since the SSE delta parser only handles
+// plain content chunks, so a client that wants progressive streaming won't
+// get propose_edits matches for that turn.
+func streamAIResponse(w http.ResponseWriter, backend StreamingBackend, messages []Message, opts CompletionOptions, convID, cleanText string) {
+	openaiResp, err := backend.Stream(context.Background(), messages, opts)
+	if err != nil {
+		log.Error().Err(err).Msg("Error making OpenAI stream request")
+		sendErrorAIResponse(w, cleanText, err.Error(), convID)
+		return
+	}
+	defer openaiResp.Body.Close()
+
+	if openaiResp.StatusCode >= 400 {
+		sendErrorAIResponse(w, cleanText, decodeProviderError(openaiResp), convID)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error().Msg("ResponseWriter does not support flushing, falling back to buffered response")
+		content, err := readSSEContent(openaiResp.Body)
+		if err != nil || content == "" {
+			return
+		}
+		if convID != "" {
+			conversationStore.Append(convID, Message{Role: "user", Content: cleanText}, Message{Role: "assistant", Content: content})
+		}
+		sendAIResponse(w, cleanText, content, convID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	var content strings.Builder
+	scanner := bufio.NewScanner(openaiResp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		delta, done := nextOpenAIChunk(line)
+		if done {
+			break
+		}
+		if delta == "" {
+			continue
+		}
+		content.WriteString(delta)
+
+		chunkJson, _ := json.Marshal(buildAIResponse(cleanText, content.String(), convID))
+		fmt.Fprintf(w, "data: %s\n\n", chunkJson)
+		flusher.Flush()
+	}
+	if err := scanner.Err(); err != nil {
+		log.Error().Err(err).Msg("Error reading OpenAI stream")
+	}
+	if final := content.String(); final != "" && convID != "" {
+		conversationStore.Append(convID, Message{Role: "user", Content: cleanText}, Message{Role: "assistant", Content: final})
+	}
+}
+
+func sendAIResponse(w http.ResponseWriter, cleanText, responseText, convID string) {
+	response := buildAIResponse(cleanText, responseText, convID)
+
+	responseJson, _ := json.MarshalIndent(response, "", "  ")
+	log.Debug().RawJSON("language_tool_response", responseJson).Msg("Response in LanguageTool API format")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// buildAIResponse assembles the LanguageTool-format payload shared by the
+// buffered and streaming response paths. convID is included in the rule
+// metadata when the response belongs to a tracked conversation.
+func buildAIResponse(cleanText, responseText, convID string) map[string]interface{} {
+	rule := map[string]interface{}{
+		"id":          "AI_RESPONSE",
+		"description": "Response from AI API",
+		"issueType":   "recommendations",
+		"category": map[string]interface{}{
+			"id":   "AI",
+			"name": "AI Responses",
+		},
+	}
+	if convID != "" {
+		rule["conversationId"] = convID
+	}
+
+	return map[string]interface{}{
 		"software": map[string]interface{}{
 			"name":       "LT-AI-mixer",
 			"apiVersion": 1,
@@ -163,25 +434,10 @@ func sendAIResponse(w http.ResponseWriter, cleanText, responseText string) {
 					"offset": len([]rune(cleanText)),
 					"length": 4,
 				},
-				"rule": map[string]interface{}{
-					"id":          "AI_RESPONSE",
-					"description": "Response from AI API",
-					"issueType":   "recommendations",
-					"category": map[string]interface{}{
-						"id":   "AI",
-						"name": "AI Responses",
-					},
-				},
+				"rule": rule,
 			},
 		},
 	}
-
-	responseJson, _ := json.MarshalIndent(response, "", "  ")
-	log.Debug().RawJSON("language_tool_response", responseJson).Msg("Response in LanguageTool API format")
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
 }
 
 func proxyRequest(w http.ResponseWriter, r *http.Request, client *http.Client) {
@@ -229,8 +485,13 @@ func proxyRequest(w http.ResponseWriter, r *http.Request, client *http.Client) {
 func main() {
 	port := flag.String("port", "8080", "Server port")
 	logLevel := flag.String("log-level", "warn", "Logging level (debug, info, warn, error, fatal, panic)")
+	stream := flag.Bool("stream", false, "Request SSE chat completions from the upstream model")
+	configPath := flag.String("config", "", "Path to the mixer backends config file (YAML or JSON)")
+	templatesDir := flag.String("templates-dir", "", "Directory of named prompt templates (*.tmpl)")
 	flag.Parse()
 
+	streamEnabled = *stream || os.Getenv("OPENAI_STREAM") == "true"
+
 	level, err := zerolog.ParseLevel(*logLevel)
 	if err != nil {
 		level = zerolog.WarnLevel
@@ -242,8 +503,26 @@ func main() {
 		Timeout: 60 * time.Second,
 	}
 
+	if path := *configPath; path != "" {
+		loadBackendRegistry(path, client)
+	} else if path := os.Getenv("MIXER_CONFIG"); path != "" {
+		loadBackendRegistry(path, client)
+	}
+
+	conversationStore = newConversationStore()
+	rateLimiter = newRateLimiterFromEnv()
+
+	if dir := *templatesDir; dir != "" {
+		loadTemplateLibrary(dir)
+	} else if dir := os.Getenv("TEMPLATES_DIR"); dir != "" {
+		loadTemplateLibrary(dir)
+	}
+
 	// Setup handler for all paths
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if handled := handleTemplatesEndpoint(w, r); handled {
+			return
+		}
 		if handled := handleSpecialRequest(w, r, client); handled {
 			return
 		}
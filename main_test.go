@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+// TestMatchTriggerPrefersLongestSuffix guards against the nondeterministic
+// backendRegistry map iteration order: when a configured trigger is itself a
+// suffix of a longer built-in trigger, the longer one must always win.
+func TestMatchTriggerPrefersLongestSuffix(t *testing.T) {
+	backendRegistry = map[string]registeredBackend{
+		"/ai": {cfg: BackendConfig{Name: "short"}},
+	}
+	defer func() { backendRegistry = map[string]registeredBackend{} }()
+
+	for i := 0; i < 20; i++ {
+		clean, trigger, ok := matchTrigger("fix this //ai")
+		if !ok {
+			t.Fatalf("matchTrigger didn't match a trigger")
+		}
+		if trigger != defaultTrigger {
+			t.Fatalf("matchTrigger picked %q, want the longer built-in %q", trigger, defaultTrigger)
+		}
+		if clean != "fix this " {
+			t.Fatalf("matchTrigger stripped text = %q, want %q", clean, "fix this ")
+		}
+	}
+}
+
+func TestMatchTriggerNoMatch(t *testing.T) {
+	backendRegistry = map[string]registeredBackend{}
+	clean, trigger, ok := matchTrigger("just plain text")
+	if ok || trigger != "" || clean != "just plain text" {
+		t.Fatalf("matchTrigger(%q) = (%q, %q, %v), want no match", "just plain text", clean, trigger, ok)
+	}
+}
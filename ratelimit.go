@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter enforces a per-client-IP token-bucket limit ahead of every LLM
+// dispatch. Left nil (the default) when rate limiting isn't configured.
+var rateLimiter *RateLimiter
+
+// newRateLimiterFromEnv builds a RateLimiter from RATE_LIMIT_RPS and
+// RATE_LIMIT_BURST, or returns nil if RATE_LIMIT_RPS isn't set to a positive
+// value, i.e. rate limiting stays disabled.
+func newRateLimiterFromEnv() *RateLimiter {
+	rate, err := strconv.ParseFloat(os.Getenv("RATE_LIMIT_RPS"), 64)
+	if err != nil || rate <= 0 {
+		return nil
+	}
+
+	burst := rate
+	if b, err := strconv.ParseFloat(os.Getenv("RATE_LIMIT_BURST"), 64); err == nil && b > 0 {
+		burst = b
+	}
+
+	return newRateLimiter(rate, burst)
+}
+
+// RateLimiter hands out a token bucket per key (typically client IP).
+type RateLimiter struct {
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	rate     float64
+	capacity float64
+}
+
+func newRateLimiter(rate, capacity float64) *RateLimiter {
+	return &RateLimiter{
+		buckets:  make(map[string]*tokenBucket),
+		rate:     rate,
+		capacity: capacity,
+	}
+}
+
+// Allow reports whether key may proceed now, and if not, how long it should
+// wait before retrying.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(l.rate, l.capacity)
+		l.buckets[key] = bucket
+	}
+	l.mu.Unlock()
+
+	return bucket.take()
+}
+
+// tokenBucket is a classic token-bucket limiter: tokens refill continuously
+// at rate per second up to capacity, and each request consumes one token.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	updated  time.Time
+}
+
+func newTokenBucket(rate, capacity float64) *tokenBucket {
+	return &tokenBucket{
+		rate:     rate,
+		capacity: capacity,
+		tokens:   capacity,
+		updated:  time.Now(),
+	}
+}
+
+func (b *tokenBucket) take() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
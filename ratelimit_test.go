@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllowsBurstThenThrottles(t *testing.T) {
+	b := newTokenBucket(1, 3)
+
+	for i := 0; i < 3; i++ {
+		allowed, wait := b.take()
+		if !allowed || wait != 0 {
+			t.Fatalf("take() #%d = (%v, %v), want (true, 0) while burst capacity remains", i, allowed, wait)
+		}
+	}
+
+	allowed, wait := b.take()
+	if allowed {
+		t.Fatal("take() allowed a request past the bucket's capacity")
+	}
+	if wait <= 0 {
+		t.Errorf("take() wait = %v, want a positive wait once throttled", wait)
+	}
+}
+
+func TestTokenBucketRefillsOverTime(t *testing.T) {
+	b := newTokenBucket(10, 1)
+	b.tokens = 0
+	b.updated = time.Now().Add(-200 * time.Millisecond)
+
+	allowed, _ := b.take()
+	if !allowed {
+		t.Fatal("take() should allow a request once enough time has passed to refill a token")
+	}
+}
+
+func TestTokenBucketZeroCapacityNeverAllows(t *testing.T) {
+	b := newTokenBucket(1, 0)
+
+	allowed, wait := b.take()
+	if allowed {
+		t.Fatal("take() allowed a request from a zero-capacity bucket")
+	}
+	if wait <= 0 {
+		t.Errorf("take() wait = %v, want a positive wait for a zero-capacity bucket", wait)
+	}
+}
+
+func TestRateLimiterAllowPerKey(t *testing.T) {
+	l := newRateLimiter(1, 1)
+
+	if allowed, _ := l.Allow("client-a"); !allowed {
+		t.Fatal("first request for client-a should be allowed")
+	}
+	if allowed, _ := l.Allow("client-a"); allowed {
+		t.Fatal("second immediate request for client-a should be throttled")
+	}
+	if allowed, _ := l.Allow("client-b"); !allowed {
+		t.Fatal("client-b has its own bucket and should still be allowed")
+	}
+}
+
+func TestNewRateLimiterFromEnvDisabledByDefault(t *testing.T) {
+	t.Setenv("RATE_LIMIT_RPS", "")
+	t.Setenv("RATE_LIMIT_BURST", "")
+
+	if l := newRateLimiterFromEnv(); l != nil {
+		t.Fatalf("newRateLimiterFromEnv() = %v, want nil when RATE_LIMIT_RPS is unset", l)
+	}
+}
+
+func TestNewRateLimiterFromEnvUsesBurstOverride(t *testing.T) {
+	t.Setenv("RATE_LIMIT_RPS", "1")
+	t.Setenv("RATE_LIMIT_BURST", "5")
+
+	l := newRateLimiterFromEnv()
+	if l == nil {
+		t.Fatal("newRateLimiterFromEnv() = nil, want a configured limiter")
+	}
+	if l.capacity != 5 {
+		t.Errorf("capacity = %v, want 5 from RATE_LIMIT_BURST", l.capacity)
+	}
+}
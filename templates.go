@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/rs/zerolog/log"
+)
+
+// templateTriggerPrefix selects a named prompt template, e.g.
+// "//ai:translate:en>de" or "//ai:rephrase-formal".
+const templateTriggerPrefix = "//ai:"
+
+// templateTriggerRe matches a template trigger at the end of the submitted
+// text: the template name, plus an optional ":"-separated argument.
+var templateTriggerRe = regexp.MustCompile(`//ai:[a-zA-Z0-9_-]+(?::\S+)?$`)
+
+// templateLibrary maps a prompt template's base filename (without
+// extension) to its parsed text/template, e.g. "translate" -> translate.tmpl.
+var templateLibrary = map[string]*template.Template{}
+
+// templateVars are the variables a prompt template may reference.
+type templateVars struct {
+	Text       string
+	SourceLang string
+	TargetLang string
+	Arg        string
+}
+
+// loadTemplateLibrary parses every *.tmpl file in dir into templateLibrary,
+// keyed by filename without extension.
+func loadTemplateLibrary(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Error().Err(err).Str("dir", dir).Msg("Error reading prompt templates directory")
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".tmpl" {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		tmpl, err := template.ParseFiles(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("Error parsing prompt template")
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), ".tmpl")
+		templateLibrary[name] = tmpl
+		log.Debug().Str("template", name).Msg("Loaded prompt template")
+	}
+}
+
+// parseTemplateTrigger splits a matched trigger like "//ai:translate:en>de"
+// into the template name ("translate") and its raw argument ("en>de").
+func parseTemplateTrigger(trigger string) (name, argsRaw string) {
+	rest := strings.TrimPrefix(trigger, templateTriggerPrefix)
+	if idx := strings.Index(rest, ":"); idx >= 0 {
+		return rest[:idx], rest[idx+1:]
+	}
+	return rest, ""
+}
+
+// renderPromptTemplate executes a loaded template against the cleaned text
+// and the trigger's captured argument. The raw argument is always exposed as
+// .Arg; a "source>target" argument is also split into .SourceLang/.TargetLang.
+func renderPromptTemplate(tmpl *template.Template, cleanText, argsRaw string) (string, error) {
+	vars := templateVars{Text: cleanText, Arg: argsRaw}
+	if source, target, ok := strings.Cut(argsRaw, ">"); ok {
+		vars.SourceLang = source
+		vars.TargetLang = target
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, vars); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
+
+// templateNames returns the sorted list of loaded template names, for the
+// /v2/ai/templates listing endpoint.
+func templateNames() []string {
+	names := make([]string, 0, len(templateLibrary))
+	for name := range templateLibrary {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
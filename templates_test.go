@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"text/template"
+)
+
+func TestParseTemplateTrigger(t *testing.T) {
+	tests := []struct {
+		name        string
+		trigger     string
+		wantName    string
+		wantArgsRaw string
+	}{
+		{"no args", "//ai:rephrase-formal", "rephrase-formal", ""},
+		{"with args", "//ai:translate:en>de", "translate", "en>de"},
+		{"colon in args", "//ai:translate:en>de:extra", "translate", "en>de:extra"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, argsRaw := parseTemplateTrigger(tt.trigger)
+			if name != tt.wantName || argsRaw != tt.wantArgsRaw {
+				t.Errorf("parseTemplateTrigger(%q) = (%q, %q), want (%q, %q)", tt.trigger, name, argsRaw, tt.wantName, tt.wantArgsRaw)
+			}
+		})
+	}
+}
+
+func TestTemplateTriggerRe(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"matches at end", "please fix //ai:translate:en>de", "//ai:translate:en>de"},
+		{"matches with no args", "please fix //ai:rephrase-formal", "//ai:rephrase-formal"},
+		{"no match without prefix", "please fix //gpt4", ""},
+		{"no match mid-string", "//ai:translate:en>de please fix", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := templateTriggerRe.FindString(tt.text); got != tt.want {
+				t.Errorf("templateTriggerRe.FindString(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderPromptTemplateSplitsSourceTarget(t *testing.T) {
+	tmpl := template.Must(template.New("t").Parse("{{.SourceLang}}>{{.TargetLang}}:{{.Text}}"))
+
+	got, err := renderPromptTemplate(tmpl, "hello", "en>de")
+	if err != nil {
+		t.Fatalf("renderPromptTemplate() error: %v", err)
+	}
+	if want := "en>de:hello"; got != want {
+		t.Errorf("renderPromptTemplate() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderPromptTemplateWithoutSplit(t *testing.T) {
+	tmpl := template.Must(template.New("t").Parse("arg={{.Arg}} text={{.Text}}"))
+
+	got, err := renderPromptTemplate(tmpl, "hello", "formal")
+	if err != nil {
+		t.Fatalf("renderPromptTemplate() error: %v", err)
+	}
+	if want := "arg=formal text=hello"; got != want {
+		t.Errorf("renderPromptTemplate() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderPromptTemplateEmptyArgs(t *testing.T) {
+	tmpl := template.Must(template.New("t").Parse("[{{.SourceLang}}|{{.TargetLang}}|{{.Arg}}]"))
+
+	got, err := renderPromptTemplate(tmpl, "hello", "")
+	if err != nil {
+		t.Fatalf("renderPromptTemplate() error: %v", err)
+	}
+	if want := "[||]"; got != want {
+		t.Errorf("renderPromptTemplate() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ToolCall mirrors the OpenAI chat completion `tool_calls` entry shape.
+type ToolCall struct {
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// ProposedEdit is a single structured edit the model proposes via the
+// propose_edits tool, shaped to drop straight into a LanguageTool match.
+type ProposedEdit struct {
+	Offset      int    `json:"offset"`
+	Length      int    `json:"length"`
+	Replacement string `json:"replacement"`
+	Message     string `json:"message"`
+	Category    string `json:"category"`
+}
+
+// proposeEditsTool is sent in every buffered (non-streaming) chat completion's
+// `tools` field so the model can return specific spans to fix instead of a
+// single free-text reply. Streamed completions never carry it.
+var proposeEditsTool = map[string]interface{}{
+	"type": "function",
+	"function": map[string]interface{}{
+		"name":        "propose_edits",
+		"description": "Propose specific edits to the input text as LanguageTool-style matches.",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"matches": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"offset":      map[string]interface{}{"type": "integer", "description": "Character offset where the edit starts"},
+							"length":      map[string]interface{}{"type": "integer", "description": "Number of characters the edit replaces"},
+							"replacement": map[string]interface{}{"type": "string", "description": "Suggested replacement text"},
+							"message":     map[string]interface{}{"type": "string", "description": "Explanation shown to the user"},
+							"category":    map[string]interface{}{"type": "string", "description": "Short category label, e.g. grammar, style, spelling"},
+						},
+						"required": []string{"offset", "length", "replacement", "message"},
+					},
+				},
+			},
+			"required": []string{"matches"},
+		},
+	},
+}
+
+// parseProposedEdits looks for a propose_edits call among toolCalls and
+// decodes its arguments. ok is false if no such call is present or its
+// arguments don't parse.
+func parseProposedEdits(toolCalls []ToolCall) (edits []ProposedEdit, ok bool) {
+	for _, call := range toolCalls {
+		if call.Function.Name != "propose_edits" {
+			continue
+		}
+
+		var args struct {
+			Matches []ProposedEdit `json:"matches"`
+		}
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			log.Error().Err(err).Str("arguments", call.Function.Arguments).Msg("Error decoding propose_edits arguments")
+			continue
+		}
+		return args.Matches, true
+	}
+	return nil, false
+}
+
+// sendStructuredAIResponse emits one LanguageTool match per proposed edit,
+// so editors can highlight each specific span instead of a single synthetic
+// match at offset 0.
+func sendStructuredAIResponse(w http.ResponseWriter, edits []ProposedEdit, convID string) {
+	matches := make([]map[string]interface{}, 0, len(edits))
+	for _, edit := range edits {
+		rule := map[string]interface{}{
+			"id":          "AI_RESPONSE",
+			"description": "Response from AI API",
+			"issueType":   "recommendations",
+			"category":    editCategory(edit.Category),
+		}
+		if convID != "" {
+			rule["conversationId"] = convID
+		}
+
+		matches = append(matches, map[string]interface{}{
+			"message":      edit.Message,
+			"shortMessage": "AI Response",
+			"replacements": []map[string]interface{}{
+				{"value": edit.Replacement},
+			},
+			"offset": edit.Offset,
+			"length": edit.Length,
+			"rule":   rule,
+		})
+	}
+
+	response := map[string]interface{}{
+		"software": map[string]interface{}{
+			"name":       "LT-AI-mixer",
+			"apiVersion": 1,
+		},
+		"language": map[string]interface{}{
+			"name": "English",
+			"code": "en",
+		},
+		"matches": matches,
+	}
+
+	responseJson, _ := json.MarshalIndent(response, "", "  ")
+	log.Debug().RawJSON("language_tool_response", responseJson).Msg("Response in LanguageTool API format")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// editCategory maps a proposed edit's free-text category to the LanguageTool
+// category object, falling back to the generic AI category when unset.
+func editCategory(category string) map[string]interface{} {
+	if category == "" {
+		return map[string]interface{}{"id": "AI", "name": "AI Responses"}
+	}
+	return map[string]interface{}{"id": strings.ToUpper(category), "name": category}
+}
+
+// summarizeProposedEdits renders edits as the assistant's conversation-history
+// turn, so a follow-up //ai message still has the prior proposal as context.
+func summarizeProposedEdits(edits []ProposedEdit) string {
+	raw, err := json.Marshal(edits)
+	if err != nil {
+		return "Proposed edits."
+	}
+	return string(raw)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxUpstreamRetries bounds how many times a 429/5xx response is retried
+// before the error is surfaced to the client.
+const maxUpstreamRetries = 3
+
+// maxRetryDelay caps how long a single retry will wait, regardless of what a
+// Retry-After or x-ratelimit-reset-* header asks for. Providers return those
+// headers unvalidated, and http.Client's own request timeout doesn't cover
+// time.Sleep between attempts, so a large or bogus header value could
+// otherwise block the handler goroutine for minutes across the retry loop.
+const maxRetryDelay = 5 * time.Second
+
+// doRequestWithRetry executes req, retrying 429 and 5xx responses with
+// exponential backoff honoring the Retry-After and x-ratelimit-reset-*
+// headers OpenAI-style providers return. req must have been built with
+// http.NewRequest (or otherwise set GetBody) so the body can be replayed.
+func doRequestWithRetry(client *http.Client, req *http.Request) (*http.Response, error) {
+	backoff := 500 * time.Millisecond
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt <= maxUpstreamRetries; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, berr := req.GetBody()
+			if berr != nil {
+				return nil, berr
+			}
+			req.Body = body
+		}
+
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if attempt == maxUpstreamRetries {
+			return resp, nil
+		}
+
+		wait := retryDelay(resp.Header, backoff)
+		resp.Body.Close()
+		log.Warn().Int("status", resp.StatusCode).Int("attempt", attempt+1).Dur("wait", wait).Msg("Retrying upstream request")
+		time.Sleep(wait)
+		backoff *= 2
+	}
+	return resp, err
+}
+
+// retryDelay honors a Retry-After or x-ratelimit-reset-* header when
+// present, falling back to the given exponential backoff otherwise. The
+// result is always clamped to maxRetryDelay, since these headers come
+// straight from the upstream provider and aren't trustworthy on their own.
+func retryDelay(header http.Header, fallback time.Duration) time.Duration {
+	delay := fallback
+
+	if ra := header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			delay = time.Duration(secs) * time.Second
+		} else if when, err := http.ParseTime(ra); err == nil {
+			delay = time.Until(when)
+		}
+	} else {
+		for _, name := range []string{"x-ratelimit-reset-requests", "x-ratelimit-reset-tokens"} {
+			if v := header.Get(name); v != "" {
+				if d, err := time.ParseDuration(v); err == nil {
+					delay = d
+					break
+				}
+			}
+		}
+	}
+
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// providerErrorBody is the `{error:{message,type,code}}` shape OpenAI-style
+// providers return on failure.
+type providerErrorBody struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
+
+// decodeProviderError reads a non-2xx upstream response body and formats a
+// descriptive message for the editor, falling back to the HTTP status when
+// the body doesn't match the expected shape.
+func decodeProviderError(resp *http.Response) string {
+	defer resp.Body.Close()
+
+	var body providerErrorBody
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Error.Message != "" {
+		return body.Error.Message
+	}
+	return fmt.Sprintf("Upstream error (status %d)", resp.StatusCode)
+}
+
+// sendErrorAIResponse surfaces a rate-limit or provider error as a
+// LanguageTool match with issueType "error", instead of the silent
+// 200-with-no-match the proxy used to return.
+func sendErrorAIResponse(w http.ResponseWriter, cleanText, message, convID string) {
+	rule := map[string]interface{}{
+		"id":          "AI_ERROR",
+		"description": "Error from AI API",
+		"issueType":   "error",
+		"category": map[string]interface{}{
+			"id":   "AI",
+			"name": "AI Responses",
+		},
+	}
+	if convID != "" {
+		rule["conversationId"] = convID
+	}
+
+	response := map[string]interface{}{
+		"software": map[string]interface{}{
+			"name":       "LT-AI-mixer",
+			"apiVersion": 1,
+		},
+		"language": map[string]interface{}{
+			"name": "English",
+			"code": "en",
+		},
+		"matches": []map[string]interface{}{
+			{
+				"message":      message,
+				"shortMessage": "AI Error",
+				"replacements": []map[string]interface{}{},
+				"offset":       0,
+				"length":       len([]rune(cleanText)),
+				"rule":         rule,
+			},
+		},
+	}
+
+	responseJson, _ := json.MarshalIndent(response, "", "  ")
+	log.Debug().RawJSON("language_tool_response", responseJson).Msg("Response in LanguageTool API format")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
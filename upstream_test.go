@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	fallback := 500 * time.Millisecond
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{
+			name:   "no headers falls back",
+			header: http.Header{},
+			want:   fallback,
+		},
+		{
+			name:   "Retry-After in seconds",
+			header: http.Header{"Retry-After": []string{"2"}},
+			want:   2 * time.Second,
+		},
+		{
+			name:   "Retry-After exceeding the cap is clamped",
+			header: http.Header{"Retry-After": []string{"3600"}},
+			want:   maxRetryDelay,
+		},
+		{
+			name:   "malformed Retry-After falls back",
+			header: http.Header{"Retry-After": []string{"not-a-number-or-date"}},
+			want:   fallback,
+		},
+		{
+			name:   "x-ratelimit-reset-requests duration",
+			header: http.Header{"X-Ratelimit-Reset-Requests": []string{"1s"}},
+			want:   1 * time.Second,
+		},
+		{
+			name:   "x-ratelimit-reset-requests exceeding the cap is clamped",
+			header: http.Header{"X-Ratelimit-Reset-Requests": []string{"1h"}},
+			want:   maxRetryDelay,
+		},
+		{
+			name:   "malformed x-ratelimit header falls back",
+			header: http.Header{"X-Ratelimit-Reset-Tokens": []string{"garbage"}},
+			want:   fallback,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryDelay(tt.header, fallback); got != tt.want {
+				t.Errorf("retryDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelayHonorsRetryAfterHTTPDate(t *testing.T) {
+	when := time.Now().Add(2 * time.Second).UTC()
+	header := http.Header{"Retry-After": []string{when.Format(http.TimeFormat)}}
+
+	got := retryDelay(header, 500*time.Millisecond)
+	if got <= 0 || got > 3*time.Second {
+		t.Errorf("retryDelay() = %v, want roughly 2s", got)
+	}
+}
+
+func TestRetryDelayNeverNegative(t *testing.T) {
+	when := time.Now().Add(-1 * time.Hour).UTC()
+	header := http.Header{"Retry-After": []string{when.Format(http.TimeFormat)}}
+
+	if got := retryDelay(header, 500*time.Millisecond); got != 0 {
+		t.Errorf("retryDelay() = %v, want 0 for a past Retry-After", got)
+	}
+}